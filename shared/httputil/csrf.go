@@ -0,0 +1,316 @@
+package httputil
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// tokenLength is the size, in bytes, of the real CSRF token before masking.
+const tokenLength = 32
+
+// csrfCookieName is the default name of the cookie holding the secure,
+// real CSRF token.
+const csrfCookieName = "_csrf"
+
+// csrfHeaderName is the header clients should submit the masked token in.
+const csrfHeaderName = "X-CSRF-Token"
+
+// csrfFieldName is the form field name used by templates, matching the
+// convention established by gorilla/csrf so existing templates and
+// frontends can be ported without modification.
+const csrfFieldName = "gorilla.csrf.Token"
+
+// maxTokenBodyBytes caps how much of a JSON request body extractToken
+// will buffer while looking for a csrf_token field, so a client can't
+// exhaust server memory by POSTing an unbounded body with no token
+// header or form field set.
+const maxTokenBodyBytes = 1 << 20 // 1MB
+
+type csrfContextKey struct{}
+
+type csrfContext struct {
+	realToken string
+}
+
+// Option configures the behavior of the CSRF middleware returned by
+// Protect.
+type Option func(*csrfOptions)
+
+type csrfOptions struct {
+	CookieName     string
+	MaxAge         int
+	Path           string
+	Domain         string
+	SameSite       http.SameSite
+	TrustedOrigins []string
+}
+
+// CookieName sets the name of the cookie used to store the real token.
+func CookieName(name string) Option {
+	return func(o *csrfOptions) { o.CookieName = name }
+}
+
+// MaxAge sets the MaxAge, in seconds, of the token cookie.
+func MaxAge(age int) Option {
+	return func(o *csrfOptions) { o.MaxAge = age }
+}
+
+// Path sets the cookie Path.
+func Path(path string) Option {
+	return func(o *csrfOptions) { o.Path = path }
+}
+
+// Domain sets the cookie Domain.
+func Domain(domain string) Option {
+	return func(o *csrfOptions) { o.Domain = domain }
+}
+
+// CookieSameSite sets the cookie SameSite attribute.
+func CookieSameSite(s http.SameSite) Option {
+	return func(o *csrfOptions) { o.SameSite = s }
+}
+
+// TrustedOrigins sets the list of origins permitted to submit
+// state-changing requests; see OriginCheck for the matching rules,
+// including wildcard subdomains.
+func TrustedOrigins(origins []string) Option {
+	return func(o *csrfOptions) { o.TrustedOrigins = origins }
+}
+
+// Protect returns CSRF middleware that mints a per-session real token,
+// stores it in a SecureCookie, and verifies a masked version of that
+// token on every state-changing request. Unlike a naive double-submit
+// cookie, the masked token returned to the caller changes on every
+// response so it cannot be fingerprinted via logs, caches or referrers.
+func Protect(secret []byte, opts ...Option) func(http.Handler) http.Handler {
+	o := &csrfOptions{
+		CookieName: csrfCookieName,
+		MaxAge:     12 * 3600,
+		Path:       "/",
+		SameSite:   http.SameSiteLaxMode,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	sc := csrfSecureCookie(secret, o.MaxAge)
+	originOK := OriginCheck(o.TrustedOrigins)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Bearer/personal-access-token API callers (CLI, CI) rarely
+			// send an Origin or Referer header at all, and authenticate
+			// via the Authorization header rather than a session cookie,
+			// so they can't be tricked into submitting one cross-site.
+			// They're exempt from both the origin check and the token
+			// check below; browser session-cookie requests get both.
+			tokenAuthed := isTokenAuthenticated(r)
+
+			if !tokenAuthed && !originOK(r) {
+				http.Error(w, "origin or referer header did not match expected origin", http.StatusForbidden)
+				return
+			}
+
+			real, err := realToken(r, sc, o)
+			if err != nil || len(real) != tokenLength {
+				real = make([]byte, tokenLength)
+				if _, err := io.ReadFull(rand.Reader, real); err != nil {
+					http.Error(w, "failed to generate csrf token", http.StatusInternalServerError)
+					return
+				}
+			}
+
+			if !safeMethod(r.Method) && !tokenAuthed {
+				submitted, err := unmask(extractToken(r))
+				if err != nil || !tokensEqual(submitted, real) {
+					http.Error(w, "invalid csrf token", http.StatusForbidden)
+					return
+				}
+			}
+
+			setRealTokenCookie(w, r, real, sc, o)
+
+			ctx := context.WithValue(r.Context(), csrfContextKey{}, &csrfContext{realToken: string(real)})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// isTokenAuthenticated reports whether the request authenticates via a
+// bearer token or personal access token in the Authorization header,
+// as opposed to a browser session cookie.
+func isTokenAuthenticated(r *http.Request) bool {
+	return r.Header.Get("Authorization") != ""
+}
+
+// safeMethod reports whether the HTTP method is exempt from CSRF
+// verification per RFC 7231.
+func safeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	default:
+		return false
+	}
+}
+
+// Token returns the masked CSRF token for the current request. It
+// should be used by handlers and templates to embed a fresh token on
+// every render; the mask is randomized each call so the value is safe
+// to expose in HTML.
+func Token(r *http.Request) string {
+	c, ok := r.Context().Value(csrfContextKey{}).(*csrfContext)
+	if !ok {
+		return ""
+	}
+	otp := make([]byte, tokenLength)
+	if _, err := io.ReadFull(rand.Reader, otp); err != nil {
+		return ""
+	}
+	return mask(otp, []byte(c.realToken))
+}
+
+// TemplateField returns a hidden HTML input field carrying the masked
+// CSRF token, for use in html/template-rendered forms.
+func TemplateField(r *http.Request) template.HTML {
+	return template.HTML(fmt.Sprintf(
+		`<input type="hidden" name="%s" value="%s">`, csrfFieldName, Token(r)))
+}
+
+// mask combines the one-time pad with the real token so the value
+// returned to the client changes on every call while still allowing the
+// server to recover the real token with XOR.
+func mask(otp, real []byte) string {
+	masked := make([]byte, tokenLength)
+	for i := 0; i < tokenLength; i++ {
+		masked[i] = otp[i] ^ real[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(append(otp, masked...))
+}
+
+// unmask recovers the real token from a masked token produced by mask.
+func unmask(token string) ([]byte, error) {
+	if token == "" {
+		return nil, fmt.Errorf("empty csrf token")
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded) != tokenLength*2 {
+		return nil, fmt.Errorf("malformed csrf token")
+	}
+	otp, masked := decoded[:tokenLength], decoded[tokenLength:]
+	real := make([]byte, tokenLength)
+	for i := 0; i < tokenLength; i++ {
+		real[i] = otp[i] ^ masked[i]
+	}
+	return real, nil
+}
+
+// tokensEqual performs a constant-time comparison of the submitted real
+// token against the session's real token.
+func tokensEqual(submitted, real []byte) bool {
+	return len(submitted) == len(real) && subtle.ConstantTimeCompare(submitted, real) == 1
+}
+
+// extractToken pulls the masked token from the header, form field, or
+// JSON body, in that order, so API, HTML and AJAX clients are all
+// supported without additional wiring.
+func extractToken(r *http.Request) string {
+	if tok := r.Header.Get(csrfHeaderName); tok != "" {
+		return tok
+	}
+	if tok := r.FormValue(csrfFieldName); tok != "" {
+		return tok
+	}
+
+	if strings.Contains(r.Header.Get("Content-Type"), "application/json") && r.Body != nil {
+		// Only buffer up to maxTokenBodyBytes while sniffing for the
+		// token field, but reassemble the full, unread body afterwards
+		// so a payload over the cap reaches the handler intact instead
+		// of being silently truncated.
+		head, err := ioutil.ReadAll(io.LimitReader(r.Body, maxTokenBodyBytes))
+		if err != nil {
+			return ""
+		}
+		r.Body = ioutil.NopCloser(io.MultiReader(bytes.NewReader(head), r.Body))
+
+		if int64(len(head)) == maxTokenBodyBytes {
+			// A body that fills the cap is treated as not carrying a
+			// token and is not parsed: a token inside it is not found,
+			// and no second, unbounded read is made.
+			return ""
+		}
+
+		var payload struct {
+			CSRFToken string `json:"csrf_token"`
+		}
+		if err := json.Unmarshal(head, &payload); err == nil {
+			return payload.CSRFToken
+		}
+	}
+	return ""
+}
+
+// csrfSecureCookie derives a SecureCookie from the CSRF secret, so the
+// real-token cookie is authenticated, encrypted and expiry-checked
+// through the same reviewed primitive the rest of the package's cookies
+// use, rather than a second, bespoke HMAC scheme.
+func csrfSecureCookie(secret []byte, maxAge int) *SecureCookie {
+	hashKey := sha256.Sum256(append(append([]byte{}, secret...), "csrf-hash"...))
+	blockKey := sha256.Sum256(append(append([]byte{}, secret...), "csrf-block"...))
+
+	sc, err := NewSecureCookie(hashKey[:], blockKey[:])
+	if err != nil {
+		// Unreachable: blockKey is always a fixed 32-byte sha256 sum,
+		// which aes.NewCipher always accepts.
+		panic(err)
+	}
+	sc.MaxAge = maxAge
+	return sc
+}
+
+// realToken recovers the real token from the secure cookie, verifying
+// its authenticity and expiry before trusting it.
+func realToken(r *http.Request, sc *SecureCookie, o *csrfOptions) ([]byte, error) {
+	cookie, err := r.Cookie(o.CookieName)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decodeWithKeyring(o.CookieName, cookie.Value, []*SecureCookie{sc})
+	if err != nil {
+		return nil, err
+	}
+	return base64.RawURLEncoding.DecodeString(value)
+}
+
+// setRealTokenCookie writes the secure real token cookie for the
+// session.
+func setRealTokenCookie(w http.ResponseWriter, r *http.Request, real []byte, sc *SecureCookie, o *csrfOptions) {
+	encoded, err := sc.encode(o.CookieName, base64.RawURLEncoding.EncodeToString(real))
+	if err != nil {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     o.CookieName,
+		Value:    encoded,
+		Path:     o.Path,
+		Domain:   o.Domain,
+		MaxAge:   o.MaxAge,
+		HttpOnly: true,
+		Secure:   IsHttps(r),
+		SameSite: o.SameSite,
+	})
+}
@@ -0,0 +1,204 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMaskUnmaskRoundTrip(t *testing.T) {
+	real := make([]byte, tokenLength)
+	for i := range real {
+		real[i] = byte(i)
+	}
+
+	otp := make([]byte, tokenLength)
+	for i := range otp {
+		otp[i] = byte(255 - i)
+	}
+
+	masked := mask(otp, real)
+
+	got, err := unmask(masked)
+	if err != nil {
+		t.Fatalf("unmask returned error: %v", err)
+	}
+	if string(got) != string(real) {
+		t.Fatalf("unmask(mask(otp, real)) = %x, want %x", got, real)
+	}
+}
+
+func TestUnmaskRejectsMalformedToken(t *testing.T) {
+	if _, err := unmask(""); err == nil {
+		t.Fatal("unmask(\"\") should have returned an error")
+	}
+	if _, err := unmask("not-valid-base64!!"); err == nil {
+		t.Fatal("unmask of invalid base64 should have returned an error")
+	}
+	if _, err := unmask("YQ"); err == nil {
+		t.Fatal("unmask of a too-short token should have returned an error")
+	}
+}
+
+func TestCSRFSecureCookieRoundTrip(t *testing.T) {
+	sc := csrfSecureCookie([]byte("super-secret-key"), 3600)
+	o := &csrfOptions{CookieName: csrfCookieName}
+	real := []byte("0123456789abcdef0123456789abcdef")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	setRealTokenCookie(w, r, real, sc, o)
+
+	r2 := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	for _, c := range w.Result().Cookies() {
+		r2.AddCookie(c)
+	}
+
+	got, err := realToken(r2, sc, o)
+	if err != nil {
+		t.Fatalf("realToken returned error: %v", err)
+	}
+	if string(got) != string(real) {
+		t.Fatalf("realToken = %x, want %x", got, real)
+	}
+}
+
+func TestCSRFSecureCookieRejectsWrongSecret(t *testing.T) {
+	o := &csrfOptions{CookieName: csrfCookieName}
+	real := []byte("0123456789abcdef0123456789abcdef")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	setRealTokenCookie(w, r, real, csrfSecureCookie([]byte("secret-a"), 3600), o)
+
+	r2 := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	for _, c := range w.Result().Cookies() {
+		r2.AddCookie(c)
+	}
+
+	if _, err := realToken(r2, csrfSecureCookie([]byte("secret-b"), 3600), o); err == nil {
+		t.Fatal("realToken accepted a cookie minted with a different secret")
+	}
+}
+
+func TestCSRFSecureCookieRejectsExpiredToken(t *testing.T) {
+	o := &csrfOptions{CookieName: csrfCookieName}
+	sc := csrfSecureCookie([]byte("super-secret-key"), -1)
+	real := []byte("0123456789abcdef0123456789abcdef")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	setRealTokenCookie(w, r, real, sc, o)
+
+	r2 := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	for _, c := range w.Result().Cookies() {
+		r2.AddCookie(c)
+	}
+
+	if _, err := realToken(r2, sc, o); err == nil {
+		t.Fatal("realToken accepted an expired cookie")
+	}
+}
+
+// primeCSRFSession drives a safe GET through protect to obtain the
+// session cookie and a matching masked token, as a browser would
+// before submitting a form.
+func primeCSRFSession(t *testing.T, protect func(http.Handler) http.Handler) (*http.Cookie, string) {
+	t.Helper()
+
+	var token string
+	handler := protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	handler.ServeHTTP(w, r)
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected exactly one cookie to be set, got %d", len(cookies))
+	}
+	if token == "" {
+		t.Fatal("expected a non-empty masked token after priming the session")
+	}
+	return cookies[0], token
+}
+
+func TestProtectAllowsValidSameOriginRequest(t *testing.T) {
+	protect := Protect([]byte("super-secret-key"))
+	cookie, token := primeCSRFSession(t, protect)
+
+	var reached bool
+	handler := protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "https://drone.example.com/builds", nil)
+	r.AddCookie(cookie)
+	r.Header.Set("Origin", "https://drone.example.com")
+	r.Header.Set(csrfHeaderName, token)
+	handler.ServeHTTP(w, r)
+
+	if !reached {
+		t.Fatalf("expected request to reach the handler, got status %d", w.Code)
+	}
+}
+
+func TestProtectRejectsMissingToken(t *testing.T) {
+	protect := Protect([]byte("super-secret-key"))
+	cookie, _ := primeCSRFSession(t, protect)
+
+	handler := protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be reached without a valid csrf token")
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "https://drone.example.com/builds", nil)
+	r.AddCookie(cookie)
+	r.Header.Set("Origin", "https://drone.example.com")
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestProtectRejectsCrossOriginRequest(t *testing.T) {
+	protect := Protect([]byte("super-secret-key"))
+	cookie, token := primeCSRFSession(t, protect)
+
+	handler := protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be reached for a cross-origin request")
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "https://drone.example.com/builds", nil)
+	r.AddCookie(cookie)
+	r.Header.Set("Origin", "https://evil.example.com")
+	r.Header.Set(csrfHeaderName, token)
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestProtectExemptsTokenAuthenticatedRequests(t *testing.T) {
+	protect := Protect([]byte("super-secret-key"))
+
+	var reached bool
+	handler := protect(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "https://drone.example.com/builds", nil)
+	r.Header.Set("Authorization", "Bearer sometoken")
+	handler.ServeHTTP(w, r)
+
+	if !reached {
+		t.Fatalf("expected bearer-authenticated request to bypass the csrf cookie check, got status %d", w.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package httputil
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginCheck returns a predicate implementing the OWASP "verify
+// Origin / Referer" CSRF defense: for state-changing methods it
+// requires the Origin (falling back to Referer) header to match the
+// request's own effective origin or one of allowedOrigins. Protect runs
+// it ahead of its token check for browser session-cookie requests;
+// token-authenticated API clients (Bearer JWT or personal access token
+// in Authorization) skip both this check and the XSRF cookie there.
+//
+// allowedOrigins only needs to list additional, cross-origin callers;
+// same-origin requests are always allowed. Entries are scheme+host+port,
+// e.g. "https://drone.example.com", and may use a wildcard subdomain
+// such as "https://*.example.com" to match any subdomain of
+// example.com.
+func OriginCheck(allowedOrigins []string) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		if safeMethod(r.Method) {
+			return true
+		}
+
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			origin = r.Header.Get("Referer")
+		}
+		if origin == "" {
+			// Non-browser clients (CLI, CI) rarely send either header.
+			// A request carrying neither is allowed over plain HTTP and
+			// rejected outright over HTTPS, where a same-origin browser
+			// request is always expected to carry one.
+			return !IsHttps(r)
+		}
+
+		// The request's own effective origin is always implicitly
+		// trusted, same as a browser's same-origin policy would allow;
+		// allowedOrigins only needs to list additional, cross-origin
+		// callers.
+		allowed := append([]string{GetURL(r)}, allowedOrigins...)
+		return originAllowed(origin, allowed)
+	}
+}
+
+// originAllowed reports whether origin (or the origin component of a
+// Referer URL) matches one of allowed, honoring a leading "*." wildcard
+// for subdomain matching.
+func originAllowed(origin string, allowed []string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+	candidate := u.Scheme + "://" + u.Host
+
+	for _, a := range allowed {
+		if matchOrigin(candidate, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin compares a scheme+host+port candidate against an allowed
+// pattern, which may contain a single "*." wildcard label in the host
+// (e.g. "https://*.example.com").
+func matchOrigin(candidate, pattern string) bool {
+	if candidate == pattern {
+		return true
+	}
+
+	scheme, host, ok := splitOrigin(pattern)
+	if !ok || !strings.HasPrefix(host, "*.") {
+		return false
+	}
+
+	cScheme, cHost, ok := splitOrigin(candidate)
+	if !ok || cScheme != scheme {
+		return false
+	}
+
+	suffix := host[1:] // ".example.com"
+	return strings.HasSuffix(cHost, suffix) && cHost != suffix[1:]
+}
+
+// splitOrigin splits a scheme://host[:port] string into its scheme and
+// host components.
+func splitOrigin(origin string) (scheme, host string, ok bool) {
+	parts := strings.SplitN(origin, "://", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,86 @@
+package httputil
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchOriginExact(t *testing.T) {
+	if !matchOrigin("https://drone.example.com", "https://drone.example.com") {
+		t.Fatal("expected exact origin match to succeed")
+	}
+}
+
+func TestMatchOriginWildcardSubdomain(t *testing.T) {
+	if !matchOrigin("https://ci.example.com", "https://*.example.com") {
+		t.Fatal("expected ci.example.com to match https://*.example.com")
+	}
+}
+
+func TestMatchOriginWildcardRejectsLookalikeSuffix(t *testing.T) {
+	if matchOrigin("https://evilexample.com", "https://*.example.com") {
+		t.Fatal("evilexample.com must not match https://*.example.com")
+	}
+}
+
+func TestMatchOriginWildcardRejectsBareApex(t *testing.T) {
+	if matchOrigin("https://example.com", "https://*.example.com") {
+		t.Fatal("bare apex domain must not match a subdomain-only wildcard")
+	}
+}
+
+func TestMatchOriginRejectsSchemeMismatch(t *testing.T) {
+	if matchOrigin("http://ci.example.com", "https://*.example.com") {
+		t.Fatal("scheme mismatch must not match")
+	}
+}
+
+func TestOriginCheckAllowsSafeMethodsRegardless(t *testing.T) {
+	check := OriginCheck(nil)
+	r := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+
+	if !check(r) {
+		t.Fatal("OriginCheck must allow safe methods even with a mismatched Origin")
+	}
+}
+
+func TestOriginCheckAllowsImplicitSameOrigin(t *testing.T) {
+	check := OriginCheck(nil)
+	r := httptest.NewRequest("POST", "https://drone.example.com/builds", nil)
+	r.Header.Set("Origin", "https://drone.example.com")
+
+	if !check(r) {
+		t.Fatal("OriginCheck must implicitly trust the request's own origin")
+	}
+}
+
+func TestOriginCheckAllowsExplicitlyTrustedOrigin(t *testing.T) {
+	check := OriginCheck([]string{"https://*.ci.example.com"})
+	r := httptest.NewRequest("POST", "https://drone.example.com/builds", nil)
+	r.Header.Set("Origin", "https://agent-1.ci.example.com")
+
+	if !check(r) {
+		t.Fatal("OriginCheck must allow an origin matching TrustedOrigins")
+	}
+}
+
+func TestOriginCheckRejectsUntrustedCrossOrigin(t *testing.T) {
+	check := OriginCheck(nil)
+	r := httptest.NewRequest("POST", "https://drone.example.com/builds", nil)
+	r.Header.Set("Origin", "https://evil.example.com")
+
+	if check(r) {
+		t.Fatal("OriginCheck must reject an untrusted cross-origin request")
+	}
+}
+
+func TestOriginCheckFallsBackToReferer(t *testing.T) {
+	check := OriginCheck(nil)
+	r := httptest.NewRequest("POST", "https://drone.example.com/builds", nil)
+	r.Header.Set("Referer", "https://drone.example.com/settings")
+
+	if !check(r) {
+		t.Fatal("OriginCheck must fall back to the Referer header when Origin is absent")
+	}
+}
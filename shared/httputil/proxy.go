@@ -0,0 +1,200 @@
+package httputil
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// defaultHost is returned by GetHost when neither the request nor a
+// trusted proxy supplies a hostname and no ProxyConfig.DefaultHost is
+// configured.
+const defaultHost = ""
+
+// ProxyConfig controls how much of a reverse proxy's forwarding headers
+// this package is willing to trust. Only requests whose RemoteAddr falls
+// inside TrustedProxies have their Forwarded / X-Forwarded-* headers
+// honored; all other requests are resolved solely from the connection
+// itself, preventing a client from spoofing its way past IsHttps or
+// impersonating a different Host.
+type ProxyConfig struct {
+	// TrustedProxies is the set of CIDR ranges allowed to set forwarding
+	// headers on behalf of a client.
+	TrustedProxies []net.IPNet
+
+	// DefaultHost is returned by GetHost when no host can otherwise be
+	// determined. It replaces the previous hardcoded "localhost:8080".
+	DefaultHost string
+}
+
+// defaultProxyConfig is used by IsHttps, GetScheme, GetHost and GetURL
+// when no *ProxyConfig is passed explicitly. It is unset (nil) by
+// default, meaning forwarding headers are never trusted until the
+// server configures one at startup via SetDefaultProxyConfig.
+var defaultProxyConfig *ProxyConfig
+
+// SetDefaultProxyConfig installs the package-level ProxyConfig used by
+// calls that don't supply one explicitly. It should be called once at
+// startup, after parsing the trusted proxy CIDRs from configuration.
+func SetDefaultProxyConfig(c *ProxyConfig) {
+	defaultProxyConfig = c
+}
+
+// NewProxyConfig parses the given CIDR strings (e.g. "10.0.0.0/8") into
+// a ProxyConfig. A bare IP address (no "/") is treated as a /32 or /128.
+func NewProxyConfig(cidrs []string) (*ProxyConfig, error) {
+	nets := make([]net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if !strings.Contains(cidr, "/") {
+			if strings.Contains(cidr, ":") {
+				cidr += "/128"
+			} else {
+				cidr += "/32"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		nets = append(nets, *ipnet)
+	}
+	return &ProxyConfig{TrustedProxies: nets}, nil
+}
+
+// trusted reports whether r.RemoteAddr falls inside one of the
+// configured trusted proxy ranges.
+func (c *ProxyConfig) trusted(r *http.Request) bool {
+	if c == nil || len(c.TrustedProxies) == 0 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, ipnet := range c.TrustedProxies {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyConfig resolves the effective ProxyConfig for a call: the one
+// passed explicitly, if any, otherwise the package-level default.
+func proxyConfig(conf []*ProxyConfig) *ProxyConfig {
+	if len(conf) != 0 && conf[0] != nil {
+		return conf[0]
+	}
+	return defaultProxyConfig
+}
+
+// forwarded holds the fields recognized from an RFC 7239 Forwarded
+// header or their legacy X-Forwarded-* equivalents.
+type forwarded struct {
+	Proto string
+	Host  string
+	For   string
+}
+
+// Forwarded parses the RFC 7239 Forwarded header, falling back to the
+// legacy X-Forwarded-Proto, X-Forwarded-Host and X-Forwarded-For
+// headers for any field it doesn't specify. Only the first (closest to
+// client) element of the header is used. Callers are responsible for
+// checking that the peer is a trusted proxy before relying on the
+// result.
+func Forwarded(r *http.Request) *forwarded {
+	f := &forwarded{
+		Proto: r.Header.Get("X-Forwarded-Proto"),
+		Host:  r.Header.Get("X-Forwarded-Host"),
+		For:   r.Header.Get("X-Forwarded-For"),
+	}
+
+	header := r.Header.Get("Forwarded")
+	if header == "" {
+		return f
+	}
+
+	// Only the first element describes the original client; later
+	// elements describe intermediate proxies.
+	first := strings.Split(header, ",")[0]
+	for _, pair := range strings.Split(first, ";") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		val := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+
+		switch key {
+		case "proto":
+			f.Proto = val
+		case "host":
+			f.Host = val
+		case "for":
+			f.For = strings.Trim(val, "[]")
+		}
+	}
+	return f
+}
+
+// IsHttps is a helper function that evaluates the http.Request
+// and returns True if the Request uses HTTPS. If the peer is a
+// trusted proxy (see ProxyConfig), the Forwarded/X-Forwarded-Proto
+// header is honored to detect SSL termination upstream; otherwise only
+// the connection itself (r.TLS / r.URL.Scheme) is trusted.
+func IsHttps(r *http.Request, conf ...*ProxyConfig) bool {
+	return GetScheme(r, conf...) == "https"
+}
+
+// GetScheme is a helper function that evaluates the http.Request
+// and returns the scheme, HTTP or HTTPS. If the peer is a trusted
+// proxy (see ProxyConfig), the Forwarded/X-Forwarded-Proto header is
+// honored; otherwise only the connection itself is trusted.
+func GetScheme(r *http.Request, conf ...*ProxyConfig) string {
+	if r.URL.Scheme == "https" || r.TLS != nil || strings.HasPrefix(r.Proto, "HTTPS") {
+		return "https"
+	}
+
+	c := proxyConfig(conf)
+	if c.trusted(r) {
+		if proto := Forwarded(r).Proto; proto == "https" {
+			return "https"
+		}
+	}
+	return "http"
+}
+
+// GetHost is a helper function that evaluates the http.Request
+// and returns the hostname. If the peer is a trusted proxy (see
+// ProxyConfig), the Forwarded/X-Forwarded-Host header is honored to
+// recover the original hostname; otherwise only r.Host is trusted.
+func GetHost(r *http.Request, conf ...*ProxyConfig) string {
+	c := proxyConfig(conf)
+	if c.trusted(r) {
+		if host := Forwarded(r).Host; host != "" {
+			return host
+		}
+	}
+
+	switch {
+	case len(r.Host) != 0:
+		return r.Host
+	case len(r.URL.Host) != 0:
+		return r.URL.Host
+	case c != nil && c.DefaultHost != "":
+		return c.DefaultHost
+	default:
+		return defaultHost
+	}
+}
+
+// GetURL is a helper function that evaluates the http.Request
+// and returns the URL as a string. Only the scheme + hostname
+// are included; the path is excluded.
+func GetURL(r *http.Request, conf ...*ProxyConfig) string {
+	return GetScheme(r, conf...) + "://" + GetHost(r, conf...)
+}
@@ -0,0 +1,126 @@
+package httputil
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestProxyConfigTrustedAllowsConfiguredRange(t *testing.T) {
+	conf, err := NewProxyConfig([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewProxyConfig returned error: %v", err)
+	}
+
+	r := &http.Request{RemoteAddr: "10.1.2.3:54321"}
+	if !conf.trusted(r) {
+		t.Fatal("expected 10.1.2.3 to be trusted")
+	}
+}
+
+func TestProxyConfigTrustedRejectsUntrustedPeer(t *testing.T) {
+	conf, err := NewProxyConfig([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewProxyConfig returned error: %v", err)
+	}
+
+	r := &http.Request{RemoteAddr: "203.0.113.7:54321"}
+	if conf.trusted(r) {
+		t.Fatal("expected 203.0.113.7 to be untrusted")
+	}
+}
+
+func TestProxyConfigTrustedRejectsWhenUnconfigured(t *testing.T) {
+	var conf *ProxyConfig
+	r := &http.Request{RemoteAddr: "10.1.2.3:54321"}
+	if conf.trusted(r) {
+		t.Fatal("a nil ProxyConfig should never be trusted")
+	}
+}
+
+func TestForwardedPrefersRFC7239OverLegacyHeaders(t *testing.T) {
+	r := &http.Request{Header: http.Header{}}
+	r.Header.Set("X-Forwarded-Proto", "http")
+	r.Header.Set("X-Forwarded-Host", "legacy.example.com")
+	r.Header.Set("Forwarded", `proto=https;host="drone.example.com";for=198.51.100.1`)
+
+	f := Forwarded(r)
+	if f.Proto != "https" {
+		t.Errorf("Proto = %q, want https", f.Proto)
+	}
+	if f.Host != "drone.example.com" {
+		t.Errorf("Host = %q, want drone.example.com", f.Host)
+	}
+	if f.For != "198.51.100.1" {
+		t.Errorf("For = %q, want 198.51.100.1", f.For)
+	}
+}
+
+func TestForwardedFallsBackToLegacyHeaders(t *testing.T) {
+	r := &http.Request{Header: http.Header{}}
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "drone.example.com")
+
+	f := Forwarded(r)
+	if f.Proto != "https" || f.Host != "drone.example.com" {
+		t.Errorf("Forwarded = %+v, want proto=https host=drone.example.com", f)
+	}
+}
+
+func proxiedRequest(t *testing.T, remoteAddr string) *http.Request {
+	t.Helper()
+	r := httptest.NewRequest("GET", "http://drone.internal/", nil)
+	r.RemoteAddr = remoteAddr
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "public.example.com")
+	return r
+}
+
+func TestGetSchemeIgnoresForwardedHeaderFromUntrustedPeer(t *testing.T) {
+	conf, err := NewProxyConfig([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewProxyConfig returned error: %v", err)
+	}
+
+	r := proxiedRequest(t, "203.0.113.7:54321")
+	if got := GetScheme(r, conf); got != "http" {
+		t.Fatalf("GetScheme = %q, want http for an untrusted peer", got)
+	}
+	if IsHttps(r, conf) {
+		t.Fatal("IsHttps should be false for an untrusted peer despite X-Forwarded-Proto")
+	}
+	if got := GetHost(r, conf); got != "drone.internal" {
+		t.Fatalf("GetHost = %q, want drone.internal for an untrusted peer", got)
+	}
+}
+
+func TestGetSchemeHonorsForwardedHeaderFromTrustedPeer(t *testing.T) {
+	conf, err := NewProxyConfig([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("NewProxyConfig returned error: %v", err)
+	}
+
+	r := proxiedRequest(t, "10.1.2.3:54321")
+	if got := GetScheme(r, conf); got != "https" {
+		t.Fatalf("GetScheme = %q, want https for a trusted peer", got)
+	}
+	if !IsHttps(r, conf) {
+		t.Fatal("IsHttps should be true for a trusted peer with X-Forwarded-Proto: https")
+	}
+	if got := GetHost(r, conf); got != "public.example.com" {
+		t.Fatalf("GetHost = %q, want public.example.com for a trusted peer", got)
+	}
+	if got, want := GetURL(r, conf), "https://public.example.com"; got != want {
+		t.Fatalf("GetURL = %q, want %q", got, want)
+	}
+}
+
+func TestGetHostFallsBackToDefaultHost(t *testing.T) {
+	conf := &ProxyConfig{DefaultHost: "fallback.example.com"}
+
+	r := &http.Request{Header: http.Header{}, URL: &url.URL{}}
+	if got, want := GetHost(r, conf), "fallback.example.com"; got != want {
+		t.Fatalf("GetHost = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,140 @@
+package httputil
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestSecureCookie(t *testing.T) *SecureCookie {
+	t.Helper()
+	s, err := NewSecureCookie(
+		[]byte("0123456789abcdef0123456789abcdef"),
+		[]byte("0123456789abcdef"),
+	)
+	if err != nil {
+		t.Fatalf("NewSecureCookie returned error: %v", err)
+	}
+	return s
+}
+
+func TestSecureCookieEncodeDecodeRoundTrip(t *testing.T) {
+	s := newTestSecureCookie(t)
+
+	encoded, err := s.encode("session", "hello world")
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+
+	got, err := decodeWithKeyring("session", encoded, []*SecureCookie{s})
+	if err != nil {
+		t.Fatalf("decodeWithKeyring returned error: %v", err)
+	}
+	if got != "hello world" {
+		t.Fatalf("decoded value = %q, want %q", got, "hello world")
+	}
+}
+
+func TestSecureCookieRejectsValueUnderWrongName(t *testing.T) {
+	s := newTestSecureCookie(t)
+
+	encoded, err := s.encode("session", "hello world")
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+
+	if _, err := decodeWithKeyring("other-cookie", encoded, []*SecureCookie{s}); err == nil {
+		t.Fatal("expected decode under a different cookie name to fail")
+	}
+}
+
+func TestSecureCookieRotateKeysAcceptsOldKey(t *testing.T) {
+	oldKey := newTestSecureCookie(t)
+	newKey, err := NewSecureCookie(
+		[]byte("fedcba9876543210fedcba9876543210"),
+		[]byte("fedcba9876543210"),
+	)
+	if err != nil {
+		t.Fatalf("NewSecureCookie returned error: %v", err)
+	}
+
+	encoded, err := oldKey.encode("session", "hello world")
+	if err != nil {
+		t.Fatalf("encode returned error: %v", err)
+	}
+
+	keyring := RotateKeys(newKey, oldKey)
+	got, err := decodeWithKeyring("session", encoded, keyring)
+	if err != nil {
+		t.Fatalf("decodeWithKeyring returned error: %v", err)
+	}
+	if got != "hello world" {
+		t.Fatalf("decoded value = %q, want %q", got, "hello world")
+	}
+}
+
+func TestSetSecureGetSecureRoundTrip(t *testing.T) {
+	s := newTestSecureCookie(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	if err := s.SetSecure(w, r, "drone-session", "hello world"); err != nil {
+		t.Fatalf("SetSecure returned error: %v", err)
+	}
+
+	r2 := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	for _, c := range w.Result().Cookies() {
+		r2.AddCookie(c)
+	}
+
+	got, err := GetSecure(r2, "drone-session", s)
+	if err != nil {
+		t.Fatalf("GetSecure returned error: %v", err)
+	}
+	if got != "hello world" {
+		t.Fatalf("GetSecure = %q, want %q", got, "hello world")
+	}
+}
+
+func TestGetSecureRejectsTamperedCookie(t *testing.T) {
+	s := newTestSecureCookie(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	if err := s.SetSecure(w, r, "drone-session", "hello world"); err != nil {
+		t.Fatalf("SetSecure returned error: %v", err)
+	}
+
+	cookies := w.Result().Cookies()
+	// Flip a character in the middle of the value: unlike the final
+	// character, every bit of it is decoded, so any change alters the
+	// payload.
+	v := []byte(cookies[0].Value)
+	i := len(v) / 2
+	if v[i] == 'A' {
+		v[i] = 'B'
+	} else {
+		v[i] = 'A'
+	}
+	cookies[0].Value = string(v)
+
+	r2 := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	r2.AddCookie(cookies[0])
+
+	if _, err := GetSecure(r2, "drone-session", s); err == nil {
+		t.Fatal("GetSecure accepted a tampered cookie")
+	}
+}
+
+func TestDelSecureExpiresCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "https://drone.example.com/", nil)
+	DelSecure(w, r, "drone-session")
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected exactly one Set-Cookie, got %d", len(cookies))
+	}
+	if cookies[0].MaxAge >= 0 {
+		t.Fatalf("expected DelSecure to expire the cookie, got MaxAge=%d", cookies[0].MaxAge)
+	}
+}